@@ -0,0 +1,223 @@
+// Package collections defines REST API /api/collections, for grouping files into named
+// albums with an ordered member list.
+package collections
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/cienet/ldsgo/gcp/firestore"
+)
+
+const pageSize int = 50
+
+// CollectionMeta the response json of a collection.
+type CollectionMeta struct {
+	ID          string `json:"id" binding:"required"`
+	Name        string `json:"name" binding:"required"`
+	CoverFileID string `json:"coverFileId,omitempty"`
+	CreateTime  string `json:"createTime" binding:"required"`
+	UpdateTime  string `json:"updateTime" binding:"required"`
+}
+
+// CreateCollectionRequest the request json of POST /api/collections.
+type CreateCollectionRequest struct {
+	Name        string `json:"name" binding:"required"`
+	CoverFileID string `json:"coverFileId"`
+}
+
+// UpdateCollectionRequest the request json of PATCH /api/collections/{id}. CoverFileID is
+// a pointer so a PATCH that omits it leaves the existing cover untouched, rather than
+// clearing it back to empty.
+type UpdateCollectionRequest struct {
+	Name        string  `json:"name" binding:"required"`
+	CoverFileID *string `json:"coverFileId,omitempty"`
+}
+
+// AddFileRequest the request json of POST /api/collections/{id}/files. Position is
+// optional; omitting it appends the file to the end of the collection.
+type AddFileRequest struct {
+	FileID   string `json:"fileId" binding:"required"`
+	Position *int   `json:"position,omitempty"`
+}
+
+// CollectionResponse the response json of a single collection.
+type CollectionResponse struct {
+	Collection CollectionMeta `json:"collection" binding:"required"`
+}
+
+// CollectionListResponse the response json of collection listing.
+type CollectionListResponse struct {
+	Collections []CollectionMeta `json:"collections" binding:"required"`
+}
+
+func generateCollectionMeta(result *firestore.Collection) CollectionMeta {
+	return CollectionMeta{
+		ID:          result.ID,
+		Name:        result.Name,
+		CoverFileID: result.CoverFileID,
+		CreateTime:  result.CreateTime.Format("2006-01-02T15:04:05.000Z"),
+		UpdateTime:  result.UpdateTime.Format("2006-01-02T15:04:05.000Z"),
+	}
+}
+
+// response composes the http response.
+func response(c *gin.Context, code int, body interface{}) {
+	if body == nil {
+		c.String(code, "")
+	} else {
+		c.JSON(code, body)
+	}
+}
+
+func parsePageSize(sizeParam string) (int, error) {
+	if sizeParam == "" {
+		return pageSize, nil
+	}
+	return strconv.Atoi(sizeParam)
+}
+
+// PostCollections is the function for /api/collections POST endpoint.
+// This API creates a new named collection ("album") that files can be added to.
+func PostCollections(c *gin.Context) {
+	req := &CreateCollectionRequest{}
+	if err := c.BindJSON(req); err != nil {
+		response(c, http.StatusBadRequest, nil)
+		return
+	}
+
+	ctx := context.Background()
+	dbClient := firestore.NewClient(ctx)
+	defer dbClient.Close() // nolint: errcheck
+
+	id := uuid.New().String()
+	rec := &firestore.CollectionRec{Name: req.Name, CoverFileID: req.CoverFileID}
+	docSnap, err := firestore.CreateCollection(ctx, dbClient, id, rec)
+	if err != nil {
+		log.Panicln(err)
+	}
+
+	response(c, http.StatusCreated, &CollectionResponse{Collection: generateCollectionMeta(docSnap)})
+}
+
+// GetCollectionList is the function for /api/collections GET endpoint.
+// This API lists collections, most recently updated first, with a default page size of 50.
+func GetCollectionList(c *gin.Context) {
+	size, err := parsePageSize(c.Query("size"))
+	if err != nil {
+		response(c, http.StatusBadRequest, nil)
+		return
+	}
+
+	ctx := context.Background()
+	dbClient := firestore.NewClient(ctx)
+	defer dbClient.Close() // nolint: errcheck
+
+	docs, err := firestore.ListCollections(ctx, dbClient, size)
+	if err != nil {
+		log.Panicln(err)
+	}
+
+	results := []CollectionMeta{}
+	for _, doc := range docs {
+		results = append(results, generateCollectionMeta(doc))
+	}
+	response(c, http.StatusOK, &CollectionListResponse{Collections: results})
+}
+
+// PatchCollection is the function for /api/collections/{id} PATCH endpoint.
+// This API renames a collection and/or changes its cover file.
+func PatchCollection(c *gin.Context) {
+	id := c.Param("id")
+
+	req := &UpdateCollectionRequest{}
+	if err := c.BindJSON(req); err != nil {
+		response(c, http.StatusBadRequest, nil)
+		return
+	}
+
+	ctx := context.Background()
+	dbClient := firestore.NewClient(ctx)
+	defer dbClient.Close() // nolint: errcheck
+
+	fields := map[string]interface{}{
+		firestore.FieldCollectionName: req.Name,
+	}
+	if req.CoverFileID != nil {
+		fields[firestore.FieldCollectionCoverFileID] = *req.CoverFileID
+	}
+	docSnap, err := firestore.MergeCollection(ctx, dbClient, id, &fields)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			response(c, http.StatusNotFound, nil)
+			return
+		}
+		log.Panicln(err)
+	}
+
+	response(c, http.StatusOK, &CollectionResponse{Collection: generateCollectionMeta(docSnap)})
+}
+
+// DeleteCollection is the function for /api/collections/{id} DELETE endpoint.
+// This API deletes a collection and its membership rows; it does not delete the member
+// files themselves.
+func DeleteCollection(c *gin.Context) {
+	id := c.Param("id")
+
+	ctx := context.Background()
+	dbClient := firestore.NewClient(ctx)
+	defer dbClient.Close() // nolint: errcheck
+
+	if err := firestore.DeleteCollection(ctx, dbClient, id); err != nil {
+		log.Panicln(err)
+	}
+
+	response(c, http.StatusNoContent, nil)
+}
+
+// PostCollectionFile is the function for /api/collections/{id}/files POST endpoint.
+// This API adds a file to a collection at the given position, appending to the end when
+// position is omitted.
+func PostCollectionFile(c *gin.Context) {
+	id := c.Param("id")
+
+	req := &AddFileRequest{}
+	if err := c.BindJSON(req); err != nil {
+		response(c, http.StatusBadRequest, nil)
+		return
+	}
+
+	ctx := context.Background()
+	dbClient := firestore.NewClient(ctx)
+	defer dbClient.Close() // nolint: errcheck
+
+	if err := firestore.AddCollectionItem(ctx, dbClient, id, req.FileID, req.Position); err != nil {
+		log.Panicln(err)
+	}
+
+	response(c, http.StatusCreated, nil)
+}
+
+// DeleteCollectionFile is the function for /api/collections/{id}/files/{fileId} DELETE endpoint.
+// This API removes a single file from a collection without deleting the file itself.
+func DeleteCollectionFile(c *gin.Context) {
+	id := c.Param("id")
+	fileID := c.Param("fileId")
+
+	ctx := context.Background()
+	dbClient := firestore.NewClient(ctx)
+	defer dbClient.Close() // nolint: errcheck
+
+	if err := firestore.RemoveCollectionItem(ctx, dbClient, id, fileID); err != nil {
+		log.Panicln(err)
+	}
+
+	response(c, http.StatusNoContent, nil)
+}
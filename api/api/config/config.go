@@ -0,0 +1,94 @@
+// Package config centralizes environment-driven configuration for the API server.
+package config
+
+import (
+	"os"
+	"strconv"
+	"time"
+)
+
+// conf is the shape of application configuration values read from environment variables.
+type conf struct {
+	// BucketName is the name of the Cloud Storage bucket backing file storage.
+	BucketName string
+	// BucketBasePath is the path prefix under which uploaded objects are written.
+	BucketBasePath string
+	// ResourceBasePath is the public base path used to build resource URLs.
+	ResourceBasePath string
+	// UploadSessionTTL is how long an unfinished resumable upload session is kept
+	// before the garbage collector reclaims it.
+	UploadSessionTTL time.Duration
+	// MaxImportSize is the largest response body, in bytes, that POST /api/files/import
+	// will fetch from a single URL.
+	MaxImportSize int64
+	// ImportTimeout bounds how long a single URL fetch for POST /api/files/import may take.
+	ImportTimeout time.Duration
+	// TrashRetention is how long a soft-deleted file is kept before the janitor purges it.
+	TrashRetention time.Duration
+	// MaxBundleSize is the largest combined FileSize, in bytes, that POST
+	// /api/files/download will zip up in a single response.
+	MaxBundleSize int64
+	// SignedURLs switches file URLs from plain public bucket paths to short-lived,
+	// V4-signed URLs, for buckets that are not world-readable.
+	SignedURLs bool
+}
+
+// Config holds the process-wide configuration, populated at startup from environment variables.
+var Config conf
+
+func init() {
+	Config = conf{
+		BucketName:       getEnv("BUCKET_NAME", ""),
+		BucketBasePath:   getEnv("BUCKET_BASE_PATH", ""),
+		ResourceBasePath: getEnv("RESOURCE_BASE_PATH", ""),
+		UploadSessionTTL: getEnvDuration("UPLOAD_SESSION_TTL", 24*time.Hour),
+		MaxImportSize:    getEnvInt64("MAX_IMPORT_SIZE", 100<<20), // 100 MiB.
+		ImportTimeout:    getEnvDuration("IMPORT_TIMEOUT", 30*time.Second),
+		TrashRetention:   getEnvDuration("TRASH_RETENTION", 30*24*time.Hour),
+		MaxBundleSize:    getEnvInt64("MAX_BUNDLE_SIZE", 1<<30), // 1 GiB.
+		SignedURLs:       getEnvBool("SIGNED_URLS", false),
+	}
+}
+
+func getEnv(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+func getEnvDuration(key string, fallback time.Duration) time.Duration {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return fallback
+	}
+	return d
+}
+
+func getEnvBool(key string, fallback bool) bool {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return fallback
+	}
+	return b
+}
+
+func getEnvInt64(key string, fallback int64) int64 {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return fallback
+	}
+	return n
+}
@@ -0,0 +1,130 @@
+// Package files: download.go streams a ZIP archive of several files back to the client
+// in one request, instead of requiring one HTTP round-trip per file.
+package files
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"cloud.google.com/go/storage"
+	"github.com/gin-gonic/gin"
+
+	"github.com/cienet/ldsgo/config"
+	"github.com/cienet/ldsgo/gcp/bucket"
+	"github.com/cienet/ldsgo/gcp/firestore"
+)
+
+// maxDownloadListSize bounds how many tagged files a `tags`-based download resolves.
+const maxDownloadListSize = 1000
+
+// DownloadRequest the request json of a bulk download. Exactly one of IDs or Tags is
+// expected to be set.
+type DownloadRequest struct {
+	IDs  []string `json:"ids"`
+	Tags []string `json:"tags"`
+}
+
+// PostDownload is the function for /api/files/download POST endpoint.
+// This API streams a ZIP archive of the files matching the given ids or tags back to the
+// client. A file whose bucket object is missing is skipped with a warning entry in the
+// archive instead of aborting the whole download.
+func PostDownload(c *gin.Context) {
+	req := &DownloadRequest{}
+	if err := c.BindJSON(req); err != nil {
+		response(c, http.StatusBadRequest, nil)
+		return
+	}
+	if len(req.IDs) == 0 && len(req.Tags) == 0 {
+		// Neither selector was given -- reject explicitly rather than falling through to
+		// ListByTags' no-filter behavior, which would zip up the most recent files instead.
+		response(c, http.StatusBadRequest, nil)
+		return
+	}
+
+	ctx := context.Background()
+	dbClient := firestore.NewClient(ctx)
+	defer dbClient.Close() // nolint: errcheck
+
+	docs, err := resolveDownloadDocs(ctx, dbClient, req)
+	if err != nil {
+		log.Panicln(err)
+	}
+
+	var totalSize int64
+	for _, doc := range docs {
+		totalSize += doc.FileSize
+	}
+	if totalSize > config.Config.MaxBundleSize {
+		response(c, http.StatusRequestEntityTooLarge, nil)
+		return
+	}
+
+	client := bucket.NewClient(ctx)
+	defer client.Close() // nolint: errcheck
+
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", `attachment; filename="files.zip"`)
+	c.Status(http.StatusOK)
+
+	zw := zip.NewWriter(c.Writer)
+	defer zw.Close() // nolint: errcheck
+
+	for _, doc := range docs {
+		if err := addToZip(ctx, client, zw, doc); err != nil {
+			log.Printf("download: skipping %s: %s", doc.Path, err)
+			addWarningEntry(zw, doc, err)
+		}
+		c.Writer.Flush()
+	}
+}
+
+// resolveDownloadDocs looks up the file metadata records a download request refers to,
+// preferring an explicit id list when given and falling back to a tag query.
+func resolveDownloadDocs(ctx context.Context, dbClient *firestore.Client, req *DownloadRequest) ([]*firestore.FileMeta, error) {
+	if len(req.IDs) > 0 {
+		var docs []*firestore.FileMeta
+		for _, id := range req.IDs {
+			doc, err := firestore.Get(ctx, dbClient, id)
+			if err != nil {
+				log.Printf("download: lookup %s failed: %s", id, err)
+				continue
+			}
+			docs = append(docs, doc)
+		}
+		return docs, nil
+	}
+
+	tags := parseTags(strings.Join(req.Tags, " "))
+	return firestore.ListByTags(ctx, dbClient, tags, "", maxDownloadListSize)
+}
+
+// addToZip copies doc's bucket object into zw as an entry named after the file.
+func addToZip(ctx context.Context, client *storage.Client, zw *zip.Writer, doc *firestore.FileMeta) error {
+	r, err := bucket.NewReader(ctx, client, doc.Path)
+	if err != nil {
+		return err
+	}
+	defer r.Close() // nolint: errcheck
+
+	w, err := zw.Create(doc.Name)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, r)
+	return err
+}
+
+// addWarningEntry records that doc could not be bundled, instead of silently dropping it.
+func addWarningEntry(zw *zip.Writer, doc *firestore.FileMeta, cause error) {
+	w, err := zw.Create(doc.Name + ".MISSING.txt")
+	if err != nil {
+		log.Printf("download: failed to write warning entry for %s: %s", doc.Name, err)
+		return
+	}
+	fmt.Fprintf(w, "File %q (id %s) could not be bundled: %s\n", doc.Name, doc.ID, cause)
+}
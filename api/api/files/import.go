@@ -0,0 +1,291 @@
+// Package files: import.go implements server-side URL fetching so clients can hand off
+// large files by reference instead of uploading the bytes themselves.
+package files
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"golang.org/x/exp/slices"
+
+	"github.com/cienet/ldsgo/config"
+	"github.com/cienet/ldsgo/gcp/bucket"
+	"github.com/cienet/ldsgo/gcp/firestore"
+)
+
+// importWorkerCount bounds how many URLs POST /api/files/import fetches concurrently.
+const importWorkerCount = 4
+
+// ImportRequest the request json of importing files from URLs.
+type ImportRequest struct {
+	URLs []string `json:"urls" binding:"required"`
+	Tags []string `json:"tags"`
+}
+
+// ImportResult the outcome of importing a single URL.
+type ImportResult struct {
+	URL   string    `json:"url" binding:"required"`
+	File  *FileMeta `json:"file,omitempty"`
+	Error string    `json:"error,omitempty"`
+}
+
+// ImportResponse the response json of a batch import.
+type ImportResponse struct {
+	Results []ImportResult `json:"results" binding:"required"`
+}
+
+// PostImport is the function for /api/files/import POST endpoint.
+// This API fetches each given URL server-side, rather than requiring the client to
+// upload the bytes, and stores the result like a regular upload. Each URL is reported
+// as its own success or error entry so a partial batch is reported cleanly.
+func PostImport(c *gin.Context) {
+	req := &ImportRequest{}
+	if err := c.BindJSON(req); err != nil {
+		response(c, http.StatusBadRequest, nil)
+		return
+	}
+
+	tags := parseTags(strings.Join(req.Tags, " "))
+	ctx := context.Background()
+	httpClient := newImportHTTPClient(config.Config.ImportTimeout)
+
+	results := importURLs(ctx, httpClient, req.URLs, tags)
+	response(c, http.StatusOK, &ImportResponse{Results: results})
+}
+
+// importURLs fetches urls through a bounded pool of importWorkerCount workers, returning
+// one ImportResult per url in the same order urls were given.
+func importURLs(ctx context.Context, httpClient *http.Client, urls []string, tags []string) []ImportResult {
+	type job struct {
+		index int
+		url   string
+	}
+
+	jobs := make(chan job)
+	results := make([]ImportResult, len(urls))
+
+	var wg sync.WaitGroup
+	for i := 0; i < importWorkerCount; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				results[j.index] = importOne(ctx, httpClient, j.url, tags)
+			}
+		}()
+	}
+
+	for i, u := range urls {
+		jobs <- job{index: i, url: u}
+	}
+	close(jobs)
+	wg.Wait()
+
+	return results
+}
+
+// importOne fetches a single URL and stores it as a file, mirroring the bucket layout
+// and Firestore record that a direct multipart upload would produce.
+func importOne(ctx context.Context, httpClient *http.Client, rawURL string, tags []string) ImportResult {
+	data, ext, err := fetchURL(ctx, httpClient, rawURL, config.Config.MaxImportSize)
+	if err != nil {
+		log.Printf("import %s failed: %s", rawURL, err)
+		return ImportResult{URL: rawURL, Error: err.Error()}
+	}
+
+	client := bucket.NewClient(ctx)
+	defer client.Close() // nolint: errcheck
+
+	id := uuid.New().String()
+	path := toBucketPath(id) + ext
+
+	hash, blurHash, err := uploadBytesToBucket(ctx, client, path, data, ext)
+	if err != nil {
+		log.Printf("import %s failed: %s", rawURL, err)
+		return ImportResult{URL: rawURL, Error: err.Error()}
+	}
+
+	dbClient := firestore.NewClient(ctx)
+	defer dbClient.Close() // nolint: errcheck
+
+	record := &firestore.FileMetaRec{
+		Path:      path,
+		Name:      filenameFromURL(rawURL, ext),
+		FileSize:  int64(len(data)),
+		Tags:      tags,
+		OrderNo:   getOrderNo(id),
+		Hash:      hash,
+		BlurHash:  blurHash,
+		SourceURL: rawURL,
+	}
+	docSnap, err := firestore.Create(ctx, dbClient, id, record)
+	if err != nil {
+		log.Printf("import %s failed: %s", rawURL, err)
+		return ImportResult{URL: rawURL, Error: err.Error()}
+	}
+
+	item, _ := generateFileMeta(ctx, client, docSnap)
+	return ImportResult{URL: rawURL, File: &item}
+}
+
+// newImportHTTPClient builds an http.Client for PostImport that refuses to connect to
+// loopback, link-local, and private-network addresses, so a URL like
+// http://169.254.169.254/... (the GCP metadata server) or http://10.0.0.1/... can't be
+// used to make this server fetch internal resources on the caller's behalf (SSRF). The
+// check runs in DialContext, which is invoked again for every redirect target, so a
+// redirect to a disallowed address is rejected too.
+func newImportHTTPClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	return &http.Client{
+		Timeout: timeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return requireFetchableScheme(req.URL)
+		},
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				host, port, err := net.SplitHostPort(addr)
+				if err != nil {
+					return nil, err
+				}
+
+				ips, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+				if err != nil {
+					return nil, err
+				}
+				if len(ips) == 0 {
+					return nil, fmt.Errorf("import: no addresses found for %s", host)
+				}
+				for _, ip := range ips {
+					if isDisallowedImportAddr(ip.IP) {
+						return nil, fmt.Errorf("import: refusing to connect to disallowed address %s", ip.IP)
+					}
+				}
+
+				// Dial the already-validated IP directly, rather than letting the dialer
+				// re-resolve host, so a DNS answer that changes between this check and the
+				// connect (DNS rebinding) can't slip a disallowed address through.
+				return dialer.DialContext(ctx, network, net.JoinHostPort(ips[0].IP.String(), port))
+			},
+		},
+	}
+}
+
+// requireFetchableScheme rejects schemes other than http/https, so a redirect (or the
+// initial URL) can't be used to reach file://, gopher://, or similar local resources.
+func requireFetchableScheme(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("import: unsupported scheme %q", u.Scheme)
+	}
+	return nil
+}
+
+// isDisallowedImportAddr reports whether ip is loopback, link-local, private, or
+// otherwise not a fetchable public address.
+func isDisallowedImportAddr(ip net.IP) bool {
+	return ip.IsLoopback() ||
+		ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() ||
+		ip.IsPrivate() ||
+		ip.IsUnspecified() ||
+		ip.IsMulticast()
+}
+
+// fetchURL downloads rawURL, rejecting bodies larger than maxSize, and returns its bytes
+// along with a file extension derived from the response's content type.
+func fetchURL(ctx context.Context, httpClient *http.Client, rawURL string, maxSize int64) (data []byte, ext string, err error) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, "", err
+	}
+	if err := requireFetchableScheme(parsed); err != nil {
+		return nil, "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, "", err
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close() // nolint: errcheck
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("fetch %q: unexpected status %s", rawURL, resp.Status)
+	}
+
+	data, err = io.ReadAll(io.LimitReader(resp.Body, maxSize+1))
+	if err != nil {
+		return nil, "", err
+	}
+	if int64(len(data)) > maxSize {
+		return nil, "", fmt.Errorf("fetch %q: body exceeds max import size of %d bytes", rawURL, maxSize)
+	}
+
+	return data, extensionFor(resp.Header.Get("Content-Type"), data), nil
+}
+
+// extensionFor picks a file extension from a response's Content-Type header, falling
+// back to sniffing the body when the header is missing or unrecognized.
+func extensionFor(contentType string, data []byte) string {
+	for _, ct := range []string{contentType, http.DetectContentType(data)} {
+		if i := strings.Index(ct, ";"); i != -1 {
+			ct = ct[:i]
+		}
+		if exts, err := mime.ExtensionsByType(ct); err == nil && len(exts) > 0 {
+			return exts[0]
+		}
+	}
+	return ""
+}
+
+// filenameFromURL derives a display name for an imported file from its source URL.
+func filenameFromURL(rawURL string, ext string) string {
+	if parsed, err := url.Parse(rawURL); err == nil {
+		if name := filepath.Base(parsed.Path); name != "." && name != "/" {
+			return name
+		}
+	}
+	return "import" + ext
+}
+
+// uploadBytesToBucket uploads an already-fetched file to the bucket, computing its
+// content hash and (for images) a thumbnail with a BlurHash placeholder -- the
+// import-from-URL counterpart to uploadToBucket, which operates on a multipart file.
+func uploadBytesToBucket(ctx context.Context, client *storage.Client, path string, data []byte, ext string) (hash string, blurHash string, err error) {
+	hasher := sha256.New()
+	w := bucket.NewWriter(ctx, client, path)
+	if _, err = io.Copy(io.MultiWriter(w, hasher), bytes.NewReader(data)); err != nil {
+		w.Close() // nolint: errcheck
+		return "", "", err
+	}
+	if err = w.Close(); err != nil {
+		return "", "", err
+	}
+	hash = hex.EncodeToString(hasher.Sum(nil))
+
+	if slices.Contains(imageTypes, strings.ToLower(ext)) {
+		if _, err = bucket.TransWrite(ctx, client, toThumbnailPath(path), bytes.NewReader(data), newThumbnailTranscoder(&blurHash)); err != nil {
+			return hash, "", err
+		}
+	}
+	return hash, blurHash, nil
+}
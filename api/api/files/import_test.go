@@ -0,0 +1,57 @@
+package files
+
+import (
+	"net"
+	"net/url"
+	"testing"
+)
+
+func TestIsDisallowedImportAddr(t *testing.T) {
+	cases := []struct {
+		ip       string
+		disallow bool
+	}{
+		{"169.254.169.254", true}, // GCP/AWS metadata server.
+		{"127.0.0.1", true},
+		{"10.0.0.1", true},
+		{"172.16.0.1", true},
+		{"192.168.1.1", true},
+		{"0.0.0.0", true},
+		{"::1", true},
+		{"fc00::1", true},
+		{"8.8.8.8", false},
+		{"93.184.216.34", false},
+	}
+	for _, tc := range cases {
+		ip := net.ParseIP(tc.ip)
+		if ip == nil {
+			t.Fatalf("failed to parse test IP %q", tc.ip)
+		}
+		if got := isDisallowedImportAddr(ip); got != tc.disallow {
+			t.Errorf("isDisallowedImportAddr(%q) = %v, want %v", tc.ip, got, tc.disallow)
+		}
+	}
+}
+
+func TestRequireFetchableScheme(t *testing.T) {
+	cases := []struct {
+		rawURL  string
+		wantErr bool
+	}{
+		{"http://example.com/file.png", false},
+		{"https://example.com/file.png", false},
+		{"file:///etc/passwd", true},
+		{"gopher://example.com", true},
+		{"ftp://example.com/file", true},
+	}
+	for _, tc := range cases {
+		u, err := url.Parse(tc.rawURL)
+		if err != nil {
+			t.Fatalf("failed to parse test URL %q: %s", tc.rawURL, err)
+		}
+		err = requireFetchableScheme(u)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("requireFetchableScheme(%q) error = %v, wantErr %v", tc.rawURL, err, tc.wantErr)
+		}
+	}
+}
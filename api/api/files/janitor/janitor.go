@@ -0,0 +1,95 @@
+// Package janitor periodically purges file records that have sat in the trash longer
+// than config.Config.TrashRetention, removing their bucket objects and Firestore rows.
+package janitor
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"cloud.google.com/go/storage"
+
+	"github.com/cienet/ldsgo/config"
+	"github.com/cienet/ldsgo/gcp/bucket"
+	"github.com/cienet/ldsgo/gcp/firestore"
+)
+
+// sweepInterval is how often the janitor looks for purgeable records.
+const sweepInterval = 1 * time.Hour
+
+// Start launches a background sweeper that purges trashed file records older than
+// config.Config.TrashRetention. It should be called once at server startup; multiple
+// app replicas may call it concurrently, since each record is purged under a per-record
+// Firestore lock.
+func Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(sweepInterval)
+		defer ticker.Stop()
+		for {
+			sweep(ctx)
+			<-ticker.C
+		}
+	}()
+}
+
+func sweep(ctx context.Context) {
+	dbClient := firestore.NewClient(ctx)
+	defer dbClient.Close() // nolint: errcheck
+
+	cutoff := time.Now().Add(-config.Config.TrashRetention)
+	records, err := firestore.ListPurgeable(ctx, dbClient, cutoff)
+	if err != nil {
+		log.Printf("janitor: list purgeable records failed: %s", err)
+		return
+	}
+
+	client := bucket.NewClient(ctx)
+	defer client.Close() // nolint: errcheck
+
+	for _, record := range records {
+		purgeOne(ctx, dbClient, client, record)
+	}
+}
+
+// purgeOne permanently removes a single trashed record, first claiming a lock so that
+// when multiple app replicas run this sweep, only one of them purges the given record.
+func purgeOne(ctx context.Context, dbClient *firestore.Client, client *storage.Client, record *firestore.FileMeta) {
+	acquired, err := firestore.AcquirePurgeLock(ctx, dbClient, record.ID)
+	if err != nil {
+		log.Printf("janitor: acquire lock for %s failed: %s", record.ID, err)
+		return
+	}
+	if !acquired {
+		return
+	}
+	defer func() {
+		if err := firestore.ReleasePurgeLock(ctx, dbClient, record.ID); err != nil {
+			log.Printf("janitor: release lock for %s failed: %s", record.ID, err)
+		}
+	}()
+
+	// Only remove the bucket object once no other record still references it --
+	// deduplicated uploads can share a single path across many records.
+	count, err := firestore.CountByPath(ctx, dbClient, record.Path)
+	if err != nil {
+		log.Printf("janitor: count references to %s failed: %s", record.Path, err)
+		return
+	}
+	if count <= 1 {
+		if _, err := bucket.Delete(ctx, client, record.Path, bucket.ThumbnailPath(record.Path)); err != nil {
+			log.Printf("janitor: delete bucket object %s failed: %s", record.Path, err)
+			return
+		}
+	}
+
+	if len(record.Collections) > 0 {
+		if err := firestore.RemoveFileFromCollections(ctx, dbClient, record.ID, record.Collections); err != nil {
+			log.Printf("janitor: remove %s from collections failed: %s", record.ID, err)
+			return
+		}
+	}
+
+	if err := firestore.Delete(ctx, dbClient, record.ID); err != nil {
+		log.Printf("janitor: delete record %s failed: %s", record.ID, err)
+	}
+}
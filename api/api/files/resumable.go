@@ -0,0 +1,277 @@
+// Package files: resumable.go implements a tus-style resumable upload protocol on top of
+// GCS resumable sessions, for files too large to upload reliably in one request.
+package files
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"cloud.google.com/go/storage"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"golang.org/x/exp/slices"
+
+	"github.com/cienet/ldsgo/config"
+	"github.com/cienet/ldsgo/gcp/bucket"
+	"github.com/cienet/ldsgo/gcp/firestore"
+)
+
+// CreateUploadRequest is the request json of starting a resumable upload.
+type CreateUploadRequest struct {
+	Name string   `json:"name" binding:"required"`
+	Size int64    `json:"size" binding:"required"`
+	Tags []string `json:"tags"`
+}
+
+// UploadSessionResponse the response json of a resumable upload session.
+type UploadSessionResponse struct {
+	ID     string `json:"id" binding:"required"`
+	Offset int64  `json:"offset"`
+	Size   int64  `json:"size" binding:"required"`
+}
+
+// CreateUpload is the function for /api/files/uploads POST endpoint.
+// This API starts a resumable upload session for a file of the given name and size,
+// returning an id that the caller then PATCHes byte ranges to.
+func CreateUpload(c *gin.Context) {
+	req := &CreateUploadRequest{}
+	if err := c.BindJSON(req); err != nil {
+		response(c, http.StatusBadRequest, nil)
+		return
+	}
+
+	ctx := context.Background()
+	id := uuid.New().String()
+	path := toBucketPath(id)
+
+	session, err := bucket.InitResumable(ctx, path, req.Size)
+	if err != nil {
+		log.Panicln(err)
+	}
+
+	dbClient := firestore.NewClient(ctx)
+	defer dbClient.Close() // nolint: errcheck
+
+	rec := &firestore.UploadSessionRec{
+		Path:       path,
+		Name:       filepath.Base(req.Name),
+		Tags:       parseTags(strings.Join(req.Tags, " ")),
+		Size:       req.Size,
+		Offset:     0,
+		SessionURI: session.URI,
+	}
+	if _, err := firestore.CreateUploadSession(ctx, dbClient, id, rec); err != nil {
+		log.Panicln(err)
+	}
+
+	response(c, http.StatusCreated, &UploadSessionResponse{ID: id, Offset: 0, Size: req.Size})
+}
+
+// UploadStatus is the function for /api/files/uploads/{id} HEAD endpoint.
+// This API reports the current byte offset of an in-progress upload session so the
+// client knows where to resume from after a dropped connection.
+func UploadStatus(c *gin.Context) {
+	id := c.Param("id")
+
+	ctx := context.Background()
+	dbClient := firestore.NewClient(ctx)
+	defer dbClient.Close() // nolint: errcheck
+
+	session, err := firestore.GetUploadSession(ctx, dbClient, id)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			response(c, http.StatusNotFound, nil)
+			return
+		}
+		log.Panicln(err)
+	}
+
+	c.Header("Upload-Offset", strconv.FormatInt(session.Offset, 10))
+	response(c, http.StatusOK, nil)
+}
+
+// UploadAppend is the function for /api/files/uploads/{id} PATCH endpoint.
+// This API appends the request body, starting at the `Upload-Offset` header, to the
+// session's GCS object. Once the session's total size is reached, the upload is
+// finalized into a regular FileMeta record.
+func UploadAppend(c *gin.Context) {
+	id := c.Param("id")
+
+	offset, err := strconv.ParseInt(c.GetHeader("Upload-Offset"), 10, 64)
+	if err != nil {
+		response(c, http.StatusBadRequest, nil)
+		return
+	}
+
+	ctx := context.Background()
+	dbClient := firestore.NewClient(ctx)
+	defer dbClient.Close() // nolint: errcheck
+
+	session, err := firestore.GetUploadSession(ctx, dbClient, id)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			response(c, http.StatusNotFound, nil)
+			return
+		}
+		log.Panicln(err)
+	}
+	if offset != session.Offset {
+		response(c, http.StatusConflict, nil)
+		return
+	}
+
+	length := c.Request.ContentLength
+	if length <= 0 {
+		// ContentLength is -1 when the client doesn't set it (e.g. chunked transfer
+		// encoding), in which case we have no reliable chunk size to advance the
+		// session's offset by; reject rather than corrupting it.
+		response(c, http.StatusBadRequest, nil)
+		return
+	}
+
+	done, err := bucket.AppendChunk(ctx, &bucket.ResumableSession{URI: session.SessionURI}, offset, session.Size, length, c.Request.Body)
+	if err != nil {
+		log.Panicln(err)
+	}
+
+	newOffset := offset + length
+	session, err = firestore.UpdateUploadOffset(ctx, dbClient, id, newOffset)
+	if err != nil {
+		log.Panicln(err)
+	}
+
+	if !done && newOffset < session.Size {
+		c.Header("Upload-Offset", strconv.FormatInt(newOffset, 10))
+		response(c, http.StatusOK, nil)
+		return
+	}
+
+	item, err := finalizeUpload(ctx, id, session)
+	if err != nil {
+		log.Panicln(err)
+	}
+	if err := firestore.DeleteUploadSession(ctx, dbClient, id); err != nil {
+		log.Panicln(err)
+	}
+	response(c, http.StatusCreated, &FileUpdateResponse{File: item})
+}
+
+// finalizeUpload writes the Firestore metadata record for a completed resumable upload
+// and generates a thumbnail when the uploaded file is an image, mirroring the bucket
+// layout that uploadToBucket produces for direct multipart uploads.
+func finalizeUpload(ctx context.Context, id string, session *firestore.UploadSession) (FileMeta, error) {
+	client := bucket.NewClient(ctx)
+	defer client.Close() // nolint: errcheck
+
+	hash, err := hashBucketObject(ctx, client, session.Path)
+	if err != nil {
+		return FileMeta{}, err
+	}
+
+	var blurHash string
+	ext := strings.ToLower(filepath.Ext(session.Name))
+	if slices.Contains(imageTypes, ext) {
+		if blurHash, err = generateThumbnailFromBucket(ctx, client, session.Path); err != nil {
+			return FileMeta{}, err
+		}
+	}
+
+	dbClient := firestore.NewClient(ctx)
+	defer dbClient.Close() // nolint: errcheck
+
+	record := &firestore.FileMetaRec{
+		Path:     session.Path,
+		Name:     session.Name,
+		FileSize: session.Size,
+		Tags:     session.Tags,
+		OrderNo:  getOrderNo(id),
+		Hash:     hash,
+		BlurHash: blurHash,
+	}
+	docSnap, err := firestore.Create(ctx, dbClient, id, record)
+	if err != nil {
+		return FileMeta{}, err
+	}
+	item, _ := generateFileMeta(ctx, client, docSnap)
+	return item, nil
+}
+
+// hashBucketObject reads back the already-uploaded object at path and computes its
+// SHA-256 digest, so resumable uploads are dedup-eligible just like direct ones.
+func hashBucketObject(ctx context.Context, client *storage.Client, path string) (string, error) {
+	r, err := bucket.NewReader(ctx, client, path)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close() // nolint: errcheck
+
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// generateThumbnailFromBucket reads back the already-uploaded object at path and
+// transcodes it into a thumbnail plus a BlurHash placeholder, for uploads that bypassed
+// writeThumbnailToBucket.
+func generateThumbnailFromBucket(ctx context.Context, client *storage.Client, path string) (string, error) {
+	r, err := bucket.NewReader(ctx, client, path)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close() // nolint: errcheck
+
+	var blurHash string
+	_, err = bucket.TransWrite(ctx, client, toThumbnailPath(path), r, newThumbnailTranscoder(&blurHash))
+	return blurHash, err
+}
+
+// StartUploadSessionGC launches a background sweeper that deletes abandoned upload
+// sessions -- and any partial bucket data they wrote -- once they are older than
+// config.Config.UploadSessionTTL. It should be called once at server startup.
+func StartUploadSessionGC(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+		for range ticker.C {
+			sweepStaleUploadSessions(ctx)
+		}
+	}()
+}
+
+func sweepStaleUploadSessions(ctx context.Context) {
+	dbClient := firestore.NewClient(ctx)
+	defer dbClient.Close() // nolint: errcheck
+
+	cutoff := time.Now().Add(-config.Config.UploadSessionTTL)
+	sessions, err := firestore.ListStaleUploadSessions(ctx, dbClient, cutoff)
+	if err != nil {
+		log.Printf("upload session gc: list stale sessions failed: %s", err)
+		return
+	}
+
+	client := bucket.NewClient(ctx)
+	defer client.Close() // nolint: errcheck
+
+	for _, session := range sessions {
+		if _, err := bucket.Delete(ctx, client, session.Path); err != nil {
+			log.Printf("upload session gc: delete bucket object %s failed: %s", session.Path, err)
+			continue
+		}
+		if err := firestore.DeleteUploadSession(ctx, dbClient, session.ID); err != nil {
+			log.Printf("upload session gc: delete session %s failed: %s", session.ID, err)
+		}
+	}
+}
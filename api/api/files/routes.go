@@ -3,6 +3,9 @@ package files
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"image"
 	"image/color"
 	_ "image/gif" // Register gif encoder.
@@ -15,6 +18,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/buckket/go-blurhash"
 	"github.com/cienet/ldsgo/config"
 	"github.com/cienet/ldsgo/gcp/bucket"
 	"github.com/cienet/ldsgo/gcp/firestore"
@@ -29,10 +33,18 @@ import (
 	_ "golang.org/x/image/webp" // Register webp encoder.
 )
 
+// blurHashComponentsX and blurHashComponentsY are the (x, y) DCT component counts used for
+// BlurHash placeholders.
+const blurHashComponentsX int = 4
+const blurHashComponentsY int = 3
+
 const thumbnailWidth int = 300
 const thumbnailHeight int = 300
 const pageSize int = 50
 
+// defaultSignedURLTTL is how long signed URLs embedded in list/get responses stay valid.
+const defaultSignedURLTTL = 10 * time.Minute
+
 // FileMeta the response json of FileMeta.
 type FileMeta struct {
 	ID         string   `json:"id" binding:"required"`
@@ -44,6 +56,7 @@ type FileMeta struct {
 	FileSize   int64    `json:"size" binding:"required"`
 	CreateTime string   `json:"createTime" binding:"required"`
 	UpdateTime string   `json:"updateTime" binding:"required"`
+	BlurHash   string   `json:"blurHash,omitempty"`
 }
 
 // FileUploadRequest the request form data of file uploading.
@@ -70,8 +83,16 @@ type FileListResponse struct {
 
 var imageTypes = []string{".jpg", ".jpeg", ".png", ".gif"}
 
+// uploadFailure wraps an error from uploadToBucket, letting callers several layers up
+// (createFileRecord's dedup/lock logic) tell a bad upload -- which should surface to the
+// client as 400 -- apart from an unexpected Firestore failure.
+type uploadFailure struct{ err error }
+
+func (e *uploadFailure) Error() string { return e.err.Error() }
+func (e *uploadFailure) Unwrap() error { return e.err }
+
 func toThumbnailPath(path string) string {
-	return path + "_small"
+	return bucket.ThumbnailPath(path)
 }
 
 func toBucketPath(id string) string {
@@ -100,8 +121,25 @@ func parsePageSize(sizeParam string) (int, error) {
 	return strconv.Atoi(sizeParam)
 }
 
-// writeFileToBucket uploads file to cloud storage bucket.
-func writeFileToBucket(ctx context.Context, client *storage.Client, path string, file *multipart.FileHeader, transcoder bucket.Transcoder) (size int64, err error) {
+// hashMultipartFile computes the SHA-256 digest of file's contents, used to look up
+// existing uploads with identical content before writing anything to the bucket.
+func hashMultipartFile(file *multipart.FileHeader) (string, error) {
+	f, err := file.Open()
+	if err != nil {
+		return "", err
+	}
+	defer f.Close() // nolint: errcheck
+
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// writeFileToBucket uploads file to cloud storage bucket, hashing the bytes with
+// SHA-256 as they stream through so callers can dedup identical uploads.
+func writeFileToBucket(ctx context.Context, client *storage.Client, path string, file *multipart.FileHeader, transcoder bucket.Transcoder) (size int64, hash string, err error) {
 	defer func() {
 		if err != nil {
 			log.Printf("Fail to upload file: %s to path: %s error: %s", file.Filename, path, err)
@@ -110,95 +148,138 @@ func writeFileToBucket(ctx context.Context, client *storage.Client, path string,
 
 	f, err := file.Open()
 	if err != nil {
-		return -1, err
+		return -1, "", err
 	}
 	defer f.Close() // nolint: errcheck
 
+	hasher := sha256.New()
 	if transcoder != nil {
-		size, err = bucket.TransWrite(ctx, client, path, f, transcoder)
+		size, err = bucket.TransWrite(ctx, client, path, io.TeeReader(f, hasher), transcoder)
 	} else {
-		size, err = bucket.Write(ctx, client, path, f)
+		w := bucket.NewWriter(ctx, client, path)
+		n, cerr := io.Copy(io.MultiWriter(w, hasher), f)
+		if cerr != nil {
+			w.Close() // nolint: errcheck
+			return -1, "", cerr
+		}
+		if cerr := w.Close(); cerr != nil {
+			return -1, "", cerr
+		}
+		size = n
+	}
+	if err != nil {
+		return -1, "", err
 	}
-	return size, err
+	return size, hex.EncodeToString(hasher.Sum(nil)), nil
 }
 
-// writeThumbnailToBucket uploads thumbnail to bucket.
-func writeThumbnailToBucket(ctx context.Context, client *storage.Client, path string, file *multipart.FileHeader) (int64, error) {
+// writeThumbnailToBucket uploads a thumbnail -- plus its BlurHash placeholder -- to bucket.
+func writeThumbnailToBucket(ctx context.Context, client *storage.Client, path string, file *multipart.FileHeader) (size int64, blurHash string, err error) {
 	thumbnailPath := toThumbnailPath(path)
-	return writeFileToBucket(ctx, client, thumbnailPath, file, thumbnailTranscoder)
+	size, _, err = writeFileToBucket(ctx, client, thumbnailPath, file, newThumbnailTranscoder(&blurHash))
+	return size, blurHash, err
 }
 
-// thumbnailTranscoder the transcoder to transcode image to thumbnail.
-func thumbnailTranscoder(thumbnailWriter io.Writer, imageReader io.Reader) (int64, error) {
-	img, err := imaging.Decode(imageReader)
-	if err != nil {
-		log.Printf("File decoded failed: %s", err)
-		return 0, err
-	}
+// newThumbnailTranscoder returns a transcoder that writes a PNG thumbnail to its
+// destination while computing a BlurHash of the decoded image into blurHashOut.
+func newThumbnailTranscoder(blurHashOut *string) bucket.Transcoder {
+	return func(thumbnailWriter io.Writer, imageReader io.Reader) (int64, error) {
+		img, err := imaging.Decode(imageReader)
+		if err != nil {
+			log.Printf("File decoded failed: %s", err)
+			return 0, err
+		}
 
-	thumbnail := imaging.Thumbnail(img, thumbnailWidth, thumbnailHeight, imaging.CatmullRom)
-	dst := imaging.New(thumbnailWidth, thumbnailHeight, color.NRGBA{0, 0, 0, 0})
-	dst = imaging.Paste(dst, thumbnail, image.Pt(0, 0))
+		if hash, err := blurhash.Encode(blurHashComponentsX, blurHashComponentsY, img); err != nil {
+			log.Printf("BlurHash encoding failed: %s", err)
+		} else {
+			*blurHashOut = hash
+		}
+
+		thumbnail := imaging.Thumbnail(img, thumbnailWidth, thumbnailHeight, imaging.CatmullRom)
+		dst := imaging.New(thumbnailWidth, thumbnailHeight, color.NRGBA{0, 0, 0, 0})
+		dst = imaging.Paste(dst, thumbnail, image.Pt(0, 0))
 
-	if err = imaging.Encode(thumbnailWriter, dst, imaging.PNG); err != nil {
-		return 0, nil
+		if err = imaging.Encode(thumbnailWriter, dst, imaging.PNG); err != nil {
+			return 0, nil
+		}
+		return -1, err // Unknow written size.
 	}
-	return -1, err // Unknow written size.
 }
 
-// uploadToBucket uploads file with thumbnail to bucket.
-func uploadToBucket(ctx context.Context, client *storage.Client, path string, file *multipart.FileHeader) (int64, error) {
-	size, err := writeFileToBucket(ctx, client, path, file, nil)
+// uploadToBucket uploads file with thumbnail to bucket, returning the file's size,
+// content hash and (for images) BlurHash placeholder.
+func uploadToBucket(ctx context.Context, client *storage.Client, path string, file *multipart.FileHeader) (size int64, hash string, blurHash string, err error) {
+	size, hash, err = writeFileToBucket(ctx, client, path, file, nil)
 	if err != nil {
-		return -1, err
+		return -1, "", "", err
 	}
 
 	// Upload thumbnail if it's an image.
 	ext := strings.ToLower(filepath.Ext(file.Filename))
 	if slices.Contains(imageTypes, ext) {
-		if _, err := writeThumbnailToBucket(ctx, client, path, file); err != nil {
-			return -1, err
+		if _, blurHash, err = writeThumbnailToBucket(ctx, client, path, file); err != nil {
+			return -1, "", "", err
 		}
 	}
-	return size, nil
+	return size, hash, blurHash, nil
 }
 
-// updateBucketFile deletes old file with thumbnail and upload new one to bucket.
-func updateBucketFile(ctx context.Context, path string, file *multipart.FileHeader) (id string, newPath string, size int64, err error) {
+// updateBucketFile uploads file to a new bucket path. The caller is responsible for
+// removing the old path, once the Firestore record no longer references it, via
+// deleteBucketFile so deduplicated files that are still shared by other records survive.
+func updateBucketFile(ctx context.Context, file *multipart.FileHeader) (id string, newPath string, size int64, hash string, blurHash string, err error) {
 	defer func() {
 		if err != nil {
-			log.Printf("Update bucket path %s failed: %s", path, err)
+			log.Printf("Update bucket file %s failed: %s", file.Filename, err)
 		}
 	}()
 
 	client := bucket.NewClient(ctx)
 	defer client.Close() // nolint: errcheck
 
-	if err = deleteBucketFile(ctx, client, path); err != nil {
-		return
-	}
 	id = uuid.New().String()
 	newPath = toBucketPath(id)
-	size, err = uploadToBucket(ctx, client, newPath, file)
+	size, hash, blurHash, err = uploadToBucket(ctx, client, newPath, file)
 	return
 }
 
-// deleteBucketFile deletes file with thumbnail from cloud storage bucket.
-func deleteBucketFile(ctx context.Context, client *storage.Client, path string) error {
+// deleteBucketFile deletes file with thumbnail from cloud storage bucket, but only once
+// no remaining file metadata row still references path -- uploads deduplicated via
+// content hash can share a single bucket path across many records. The reference count
+// check and the delete run under the path's lock so a concurrent dedup upload can't reuse
+// path in the gap between the count check and the delete.
+func deleteBucketFile(ctx context.Context, dbClient *firestore.Client, client *storage.Client, path string) error {
 	if path == "" {
 		log.Println("no path to delete")
 		return nil
 	}
-	thumbnailPath := toThumbnailPath(path)
-	// The path order is matter, delete file before thumbnail.
-	if _, err := bucket.Delete(ctx, client, path, thumbnailPath); err != nil {
-		return err
-	}
-	return nil
+
+	return firestore.WithPathLock(ctx, dbClient, path, func() error {
+		count, err := firestore.CountByPath(ctx, dbClient, path)
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			log.Printf("path %s still referenced by %d record(s), skipping bucket delete", path, count)
+			return nil
+		}
+
+		thumbnailPath := toThumbnailPath(path)
+		// The path order is matter, delete file before thumbnail.
+		if _, err := bucket.Delete(ctx, client, path, thumbnailPath); err != nil {
+			return err
+		}
+		return nil
+	})
 }
 
-// generateFileMeta gets data from <doc> then return a FileMeta instance.
-func generateFileMeta(result *firestore.FileMeta) FileMeta {
+// generateFileMeta gets data from <doc> then return a FileMeta instance. When
+// config.Config.SignedURLs is enabled, URL and ThumbURL are short-lived V4-signed URLs
+// instead of plain public bucket paths, and the returned expiry is non-zero. A URL whose
+// signing fails falls back to its plain public path; when that happens to the main URL,
+// the returned expiry comes from the thumbnail URL alone (or is zero).
+func generateFileMeta(ctx context.Context, client *storage.Client, result *firestore.FileMeta) (FileMeta, time.Time) {
 	var meta FileMeta
 	log.Println("result:", result.ID, result.Name, result.Path, result.Tags, result.OrderNo)
 
@@ -209,15 +290,44 @@ func generateFileMeta(result *firestore.FileMeta) FileMeta {
 	meta.FileSize = result.FileSize
 	meta.CreateTime = result.CreateTime.Format("2006-01-02T15:04:05.000Z")
 	meta.UpdateTime = result.UpdateTime.Format("2006-01-02T15:04:05.000Z")
-	meta.URL = toResourceURL(result.Path)
+
+	var expires time.Time
+	if config.Config.SignedURLs {
+		url, exp, err := bucket.SignedURL(ctx, client, result.Path, defaultSignedURLTTL)
+		if err != nil {
+			log.Printf("generateFileMeta: sign url for %s failed: %s", result.Path, err)
+			meta.URL = toResourceURL(result.Path)
+		} else {
+			meta.URL = url
+			expires = exp
+		}
+	} else {
+		meta.URL = toResourceURL(result.Path)
+	}
+
 	ext := strings.ToLower(filepath.Ext(meta.Name))
 	if slices.Contains(imageTypes, ext) {
-		meta.ThumbURL = toResourceURL(toThumbnailPath(result.Path))
+		thumbnailPath := toThumbnailPath(result.Path)
+		if config.Config.SignedURLs {
+			url, exp, err := bucket.SignedURL(ctx, client, thumbnailPath, defaultSignedURLTTL)
+			if err != nil {
+				log.Printf("generateFileMeta: sign thumbnail url for %s failed: %s", thumbnailPath, err)
+				meta.ThumbURL = toResourceURL(thumbnailPath)
+			} else {
+				meta.ThumbURL = url
+				if expires.IsZero() || exp.Before(expires) {
+					expires = exp
+				}
+			}
+		} else {
+			meta.ThumbURL = toResourceURL(thumbnailPath)
+		}
+		meta.BlurHash = result.BlurHash
 	} else {
 		meta.ThumbURL = ""
 	}
 	log.Println("final meta:", meta)
-	return meta
+	return meta, expires
 }
 
 // response composes the http response.
@@ -261,34 +371,97 @@ func PostFiles(c *gin.Context) {
 		log.Println("Process uploaded file:", filename)
 
 		id := uuid.New().String()
-		path := toBucketPath(id)
-		size, err := uploadToBucket(ctx, client, path, file)
+
+		hash, err := hashMultipartFile(file)
 		if err != nil {
 			response(c, http.StatusBadRequest, nil)
 			return
 		}
 
-		// Add data to firestore.
-		record := &firestore.FileMetaRec{
-			Path:     path,
-			Name:     filename,
-			FileSize: size,
-			Tags:     tags,
-			OrderNo:  getOrderNo(id),
-		}
-		docSnap, err := firestore.Create(ctx, dbClient, id, record)
+		docSnap, err := createFileRecord(ctx, dbClient, client, id, filename, file, hash, tags)
 		if err != nil {
+			var uploadErr *uploadFailure
+			if errors.As(err, &uploadErr) {
+				response(c, http.StatusBadRequest, nil)
+				return
+			}
 			log.Panicln(err)
 		}
 
 		// Add data to response.
-		item := generateFileMeta(docSnap)
+		item, _ := generateFileMeta(ctx, client, docSnap)
 		filesarray = append(filesarray, item)
 		log.Printf("Uploaded file: %v\n", filename)
 	}
 	response(c, http.StatusCreated, &FileListResponse{Files: filesarray})
 }
 
+// createFileRecord writes the file metadata record for an uploaded file, reusing an
+// existing bucket object when one with the same content hash already exists. The reuse
+// decision and the record write happen under the candidate path's lock, re-checking that
+// the path is still referenced after acquiring it -- otherwise a concurrent force-delete
+// could free the bucket object in the gap between the hash lookup and the lock being
+// granted, leaving the new record pointing at nothing.
+func createFileRecord(ctx context.Context, dbClient *firestore.Client, client *storage.Client, id string, filename string, file *multipart.FileHeader, hash string, tags []string) (*firestore.FileMeta, error) {
+	existing, err := firestore.FindByHash(ctx, dbClient, hash, file.Size)
+	if err != nil {
+		return nil, err
+	}
+	if existing == nil {
+		return uploadFreshFileRecord(ctx, dbClient, client, id, filename, file, hash, tags)
+	}
+
+	var docSnap *firestore.FileMeta
+	err = firestore.WithPathLock(ctx, dbClient, existing.Path, func() error {
+		count, err := firestore.CountByPath(ctx, dbClient, existing.Path)
+		if err != nil {
+			return err
+		}
+		if count == 0 {
+			// The path's last referent was deleted while we were waiting for the lock, so
+			// its bucket object is already gone; fall back to a fresh upload.
+			docSnap, err = uploadFreshFileRecord(ctx, dbClient, client, id, filename, file, hash, tags)
+			return err
+		}
+
+		log.Printf("Dedup: reusing bucket path %s for hash %s", existing.Path, hash)
+		record := &firestore.FileMetaRec{
+			Path:     existing.Path,
+			Name:     filename,
+			FileSize: file.Size,
+			Tags:     tags,
+			OrderNo:  getOrderNo(id),
+			Hash:     hash,
+			BlurHash: existing.BlurHash,
+		}
+		docSnap, err = firestore.Create(ctx, dbClient, id, record)
+		return err
+	})
+	return docSnap, err
+}
+
+// uploadFreshFileRecord uploads file to a brand new bucket path and writes its metadata
+// record, bypassing dedup -- used both when no matching hash exists and as the dedup
+// fallback when a matching hash's bucket object turns out to already be gone.
+func uploadFreshFileRecord(ctx context.Context, dbClient *firestore.Client, client *storage.Client, id string, filename string, file *multipart.FileHeader, hash string, tags []string) (*firestore.FileMeta, error) {
+	path := toBucketPath(id)
+	_, _, blurHash, err := uploadToBucket(ctx, client, path, file)
+	if err != nil {
+		return nil, &uploadFailure{err}
+	}
+
+	record := &firestore.FileMetaRec{
+		Path:     path,
+		Name:     filename,
+		FileSize: file.Size,
+		Tags:     tags,
+		OrderNo:  getOrderNo(id),
+		Hash:     hash,
+		BlurHash: blurHash,
+	}
+	return firestore.Create(ctx, dbClient, id, record)
+}
+
 // UpdateFile is function for /api/files/{id} UPDATE endpoint.
 // This API enables users to modify the file identified by the ID.
 func UpdateFile(c *gin.Context) {
@@ -299,6 +472,9 @@ func UpdateFile(c *gin.Context) {
 	dbClient := firestore.NewClient(ctx)
 	defer dbClient.Close() // nolint: errcheck
 
+	client := bucket.NewClient(ctx)
+	defer client.Close() // nolint: errcheck
+
 	// Make suer the file exists before updating.
 	meta, err := firestore.Get(ctx, dbClient, id)
 	if err != nil {
@@ -325,32 +501,49 @@ func UpdateFile(c *gin.Context) {
 		firestore.FieldTags:    tags,
 		firestore.FieldOrderNo: getOrderNo(id),
 	}
+	oldPath := ""
 	if file != nil {
 		log.Println("file:", file.Filename)
-		bucketFileID, newPath, size, err := updateBucketFile(ctx, meta.Path, file)
+		bucketFileID, newPath, size, hash, blurHash, err := updateBucketFile(ctx, file)
 		log.Println("bucketID:", bucketFileID, ", newPath:", newPath, ", err:", err)
 		if err != nil {
 			log.Panicln(err)
 		}
+		oldPath = meta.Path
 		fields[firestore.FieldPath] = newPath
 		fields[firestore.FieldName] = filepath.Base(file.Filename)
 		fields[firestore.FieldSize] = size
+		fields[firestore.FieldHash] = hash
+		fields[firestore.FieldBlurHash] = blurHash
 	}
 	newMeta, err := firestore.Merge(ctx, dbClient, id, &fields)
 	if err != nil {
 		log.Panicln(err)
 	}
 
-	item := generateFileMeta(newMeta)
+	// Only remove the old bucket object once the record no longer points to it, so a
+	// deduplicated file still shared by other records is not deleted out from under them.
+	if oldPath != "" {
+		if err := deleteBucketFile(ctx, dbClient, client, oldPath); err != nil {
+			log.Panicln(err)
+		}
+	}
+
+	item, expires := generateFileMeta(ctx, client, newMeta)
+	if !expires.IsZero() {
+		c.Header("X-URL-Expires", expires.Format(time.RFC3339))
+	}
 	response(c, http.StatusOK, &FileUpdateResponse{File: item})
 }
 
 // GetFileList is function for /api/files GET endpoint.
-// This API offers optional query parameters `tags` and `orderNo` to filter files.
+// This API offers optional query parameters `tags` and `orderNo` to filter files. Passing
+// `collection` instead lists the files in that collection, in the collection's own order.
 // The files are listed in order of `orderNo` based on last update time with a default page size of 50.
 func GetFileList(c *gin.Context) {
 	tags := parseTags(c.Query("tags"))
 	orderNo := c.Query("orderNo")
+	collectionID := c.Query("collection")
 	size, err := parsePageSize(c.Query("size"))
 	if err != nil {
 		response(c, http.StatusBadRequest, nil)
@@ -361,14 +554,22 @@ func GetFileList(c *gin.Context) {
 	dbClient := firestore.NewClient(ctx)
 	defer dbClient.Close() // nolint: errcheck
 
-	docs, err := firestore.ListByTags(ctx, dbClient, tags, orderNo, size)
+	client := bucket.NewClient(ctx)
+	defer client.Close() // nolint: errcheck
+
+	var docs []*firestore.FileMeta
+	if collectionID != "" {
+		docs, err = firestore.ListByCollection(ctx, dbClient, collectionID, size)
+	} else {
+		docs, err = firestore.ListByTags(ctx, dbClient, tags, orderNo, size)
+	}
 	if err != nil {
 		log.Panicln(err)
 	}
 
 	results := []FileMeta{}
 	for _, doc := range docs {
-		item := generateFileMeta(doc)
+		item, _ := generateFileMeta(ctx, client, doc)
 		results = append(results, item)
 	}
 
@@ -376,16 +577,16 @@ func GetFileList(c *gin.Context) {
 }
 
 // DeleteFile is function for /api/files/{id} DELETE endpoint.
-// This API enables users to delete the file identified by the ID.
+// This API moves the file identified by the ID into the trash; it remains recoverable
+// via RestoreFile until the janitor purges it. Pass `?force=true` to permanently delete
+// the file (and its bucket object, once unreferenced) immediately instead.
 func DeleteFile(c *gin.Context) {
 	ctx := context.Background()
 	id := c.Param("id")
 
-	var err error
 	dbClient := firestore.NewClient(ctx)
 	defer dbClient.Close() // nolint: errcheck
 
-	// Delete data in firestore.
 	doc, err := firestore.Get(ctx, dbClient, id)
 	if err != nil {
 		if status.Code(err) == codes.NotFound {
@@ -396,16 +597,32 @@ func DeleteFile(c *gin.Context) {
 		}
 	}
 
-	client := bucket.NewClient(ctx)
-	defer client.Close() // nolint: errcheck
+	if c.Query("force") != "true" {
+		if _, err := firestore.Trash(ctx, dbClient, id); err != nil {
+			log.Panicln(err)
+		}
+		log.Printf("Object %q moved to trash.\n", id)
+		response(c, http.StatusNoContent, nil)
+		return
+	}
 
-	if err := deleteBucketFile(ctx, client, doc.Path); err != nil {
-		log.Panicln(err)
+	if len(doc.Collections) > 0 {
+		if err := firestore.RemoveFileFromCollections(ctx, dbClient, id, doc.Collections); err != nil {
+			log.Panicln(err)
+		}
 	}
+
 	if err := firestore.Delete(ctx, dbClient, id); err != nil {
 		log.Panicln(err)
 	}
 
+	client := bucket.NewClient(ctx)
+	defer client.Close() // nolint: errcheck
+
+	if err := deleteBucketFile(ctx, dbClient, client, doc.Path); err != nil {
+		log.Panicln(err)
+	}
+
 	log.Printf("Object %q deleted.\n", id)
 	response(c, http.StatusNoContent, nil)
 }
@@ -0,0 +1,90 @@
+// Package files: signed_url.go issues a short-lived, direct-to-bucket URL for a single
+// file, for use when config.Config.SignedURLs keeps the bucket itself non-public.
+package files
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/cienet/ldsgo/gcp/bucket"
+	"github.com/cienet/ldsgo/gcp/firestore"
+)
+
+// defaultSignedURLRequestTTL and maxSignedURLRequestTTL bound the `ttl` query parameter
+// accepted by GetSignedURL.
+const defaultSignedURLRequestTTL = 5 * time.Minute
+const maxSignedURLRequestTTL = 24 * time.Hour
+
+// SignedURLResponse the response json of GetSignedURL.
+type SignedURLResponse struct {
+	URL     string `json:"url" binding:"required"`
+	Expires string `json:"expires" binding:"required"`
+}
+
+// GetSignedURL is the function for /api/files/{id}/signed-url GET endpoint.
+// This API returns a V4-signed URL granting temporary direct read access to the file's
+// bucket object, valid for the `ttl` query parameter in seconds (default 5 minutes,
+// capped at 24 hours).
+func GetSignedURL(c *gin.Context) {
+	id := c.Param("id")
+
+	ttl, err := parseSignedURLTTL(c.Query("ttl"))
+	if err != nil {
+		response(c, http.StatusBadRequest, nil)
+		return
+	}
+
+	ctx := context.Background()
+	dbClient := firestore.NewClient(ctx)
+	defer dbClient.Close() // nolint: errcheck
+
+	doc, err := firestore.Get(ctx, dbClient, id)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			response(c, http.StatusNotFound, nil)
+			return
+		}
+		log.Panicln(err)
+	}
+
+	client := bucket.NewClient(ctx)
+	defer client.Close() // nolint: errcheck
+
+	url, expires, err := bucket.SignedURL(ctx, client, doc.Path, ttl)
+	if err != nil {
+		log.Panicln(err)
+	}
+
+	c.Header("X-URL-Expires", expires.Format(time.RFC3339))
+	response(c, http.StatusOK, &SignedURLResponse{
+		URL:     url,
+		Expires: expires.Format(time.RFC3339),
+	})
+}
+
+// parseSignedURLTTL parses the `ttl` query parameter as a number of seconds, applying
+// the default and cap used by GetSignedURL.
+func parseSignedURLTTL(ttlParam string) (time.Duration, error) {
+	if ttlParam == "" {
+		return defaultSignedURLRequestTTL, nil
+	}
+	seconds, err := strconv.Atoi(ttlParam)
+	if err != nil {
+		return 0, err
+	}
+	ttl := time.Duration(seconds) * time.Second
+	if ttl <= 0 {
+		return 0, strconv.ErrRange
+	}
+	if ttl > maxSignedURLRequestTTL {
+		ttl = maxSignedURLRequestTTL
+	}
+	return ttl, nil
+}
@@ -0,0 +1,77 @@
+// Package files: trash.go lists and restores files that DeleteFile has soft-deleted,
+// before the janitor permanently purges them.
+package files
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/cienet/ldsgo/gcp/bucket"
+	"github.com/cienet/ldsgo/gcp/firestore"
+)
+
+// GetTrash is the function for /api/files/trash GET endpoint.
+// This API lists files that have been soft-deleted but not yet purged, most recently
+// trashed first, with the same default page size as GetFileList.
+func GetTrash(c *gin.Context) {
+	size, err := parsePageSize(c.Query("size"))
+	if err != nil {
+		response(c, http.StatusBadRequest, nil)
+		return
+	}
+
+	ctx := context.Background()
+	dbClient := firestore.NewClient(ctx)
+	defer dbClient.Close() // nolint: errcheck
+
+	client := bucket.NewClient(ctx)
+	defer client.Close() // nolint: errcheck
+
+	docs, err := firestore.ListTrash(ctx, dbClient, size)
+	if err != nil {
+		log.Panicln(err)
+	}
+
+	results := []FileMeta{}
+	for _, doc := range docs {
+		item, _ := generateFileMeta(ctx, client, doc)
+		results = append(results, item)
+	}
+	response(c, http.StatusOK, &FileListResponse{Files: results})
+}
+
+// RestoreFile is the function for /api/files/{id}/restore POST endpoint.
+// This API moves a trashed file back into the active file list, reassigning it a fresh
+// orderNo so it reappears at the front.
+func RestoreFile(c *gin.Context) {
+	id := c.Param("id")
+
+	ctx := context.Background()
+	dbClient := firestore.NewClient(ctx)
+	defer dbClient.Close() // nolint: errcheck
+
+	client := bucket.NewClient(ctx)
+	defer client.Close() // nolint: errcheck
+
+	meta, err := firestore.Restore(ctx, dbClient, id, getOrderNo(id))
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			response(c, http.StatusNotFound, nil)
+			return
+		}
+		log.Panicln(err)
+	}
+
+	item, expires := generateFileMeta(ctx, client, meta)
+	if !expires.IsZero() {
+		c.Header("X-URL-Expires", expires.Format(time.RFC3339))
+	}
+	response(c, http.StatusOK, &FileUpdateResponse{File: item})
+}
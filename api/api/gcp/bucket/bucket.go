@@ -0,0 +1,85 @@
+// Package bucket wraps Cloud Storage object read/write operations used by the files API.
+package bucket
+
+import (
+	"context"
+	"io"
+
+	"cloud.google.com/go/storage"
+
+	"github.com/cienet/ldsgo/config"
+)
+
+// Transcoder transforms bytes streamed from src into dst, returning the number of bytes written.
+type Transcoder func(dst io.Writer, src io.Reader) (int64, error)
+
+// NewClient creates a new Cloud Storage client using application default credentials.
+func NewClient(ctx context.Context) *storage.Client {
+	client, err := storage.NewClient(ctx)
+	if err != nil {
+		panic(err)
+	}
+	return client
+}
+
+func object(client *storage.Client, path string) *storage.ObjectHandle {
+	return client.Bucket(config.Config.BucketName).Object(path)
+}
+
+// ThumbnailPath returns the bucket path used to store path's thumbnail.
+func ThumbnailPath(path string) string {
+	return path + "_small"
+}
+
+// NewWriter opens a writer for the object at path. Callers must Close it.
+func NewWriter(ctx context.Context, client *storage.Client, path string) io.WriteCloser {
+	return object(client, path).NewWriter(ctx)
+}
+
+// Write streams src to the object at path, returning the number of bytes written.
+func Write(ctx context.Context, client *storage.Client, path string, src io.Reader) (int64, error) {
+	w := object(client, path).NewWriter(ctx)
+	n, err := io.Copy(w, src)
+	if err != nil {
+		w.Close() // nolint: errcheck
+		return -1, err
+	}
+	if err := w.Close(); err != nil {
+		return -1, err
+	}
+	return n, nil
+}
+
+// TransWrite streams src through transcoder and writes the result to the object at path.
+func TransWrite(ctx context.Context, client *storage.Client, path string, src io.Reader, transcoder Transcoder) (int64, error) {
+	w := object(client, path).NewWriter(ctx)
+	n, err := transcoder(w, src)
+	if err != nil {
+		w.Close() // nolint: errcheck
+		return -1, err
+	}
+	if err := w.Close(); err != nil {
+		return -1, err
+	}
+	return n, nil
+}
+
+// NewReader opens a reader for the object at path.
+func NewReader(ctx context.Context, client *storage.Client, path string) (io.ReadCloser, error) {
+	return object(client, path).NewReader(ctx)
+}
+
+// Delete removes the objects at the given paths. Missing objects are ignored.
+func Delete(ctx context.Context, client *storage.Client, paths ...string) (int, error) {
+	deleted := 0
+	for _, p := range paths {
+		if err := object(client, p).Delete(ctx); err != nil {
+			if err == storage.ErrObjectNotExist {
+				continue
+			}
+			return deleted, err
+		}
+		deleted++
+	}
+	return deleted, nil
+}
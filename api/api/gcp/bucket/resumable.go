@@ -0,0 +1,86 @@
+// Package bucket: resumable.go drives GCS's native resumable upload protocol directly
+// over HTTP so that a session can be initiated in one request and appended to by later,
+// unrelated requests (the storage.Writer in the client library only supports streaming
+// within a single open writer).
+package bucket
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+
+	"cloud.google.com/go/storage"
+	"golang.org/x/oauth2/google"
+
+	"github.com/cienet/ldsgo/config"
+)
+
+// ResumableSession is a GCS resumable upload session that chunks can be appended to.
+type ResumableSession struct {
+	// URI is the session URI GCS returned when the upload was initiated.
+	URI string
+}
+
+// InitResumable starts a GCS resumable upload session for the object at path and returns
+// the session to persist alongside the upload's metadata.
+func InitResumable(ctx context.Context, path string, size int64) (*ResumableSession, error) {
+	client, err := google.DefaultClient(ctx, storage.ScopeReadWrite)
+	if err != nil {
+		return nil, err
+	}
+
+	url := fmt.Sprintf(
+		"https://storage.googleapis.com/upload/storage/v1/b/%s/o?uploadType=resumable&name=%s",
+		config.Config.BucketName, path,
+	)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Upload-Content-Length", fmt.Sprintf("%d", size))
+	req.Header.Set("Content-Type", "application/json; charset=UTF-8")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close() // nolint: errcheck
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("init resumable upload for %q failed: %s", path, resp.Status)
+	}
+	return &ResumableSession{URI: resp.Header.Get("Location")}, nil
+}
+
+// AppendChunk uploads the byte range [offset, offset+length) of the session's total size
+// to an in-progress resumable session. It reports done=true once GCS confirms the object
+// is fully assembled.
+func AppendChunk(ctx context.Context, session *ResumableSession, offset, size, length int64, data io.Reader) (done bool, err error) {
+	client, err := google.DefaultClient(ctx, storage.ScopeReadWrite)
+	if err != nil {
+		return false, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, session.URI, data)
+	if err != nil {
+		return false, err
+	}
+	req.ContentLength = length
+	req.Header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", offset, offset+length-1, size))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close() // nolint: errcheck
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusCreated:
+		return true, nil
+	case http.StatusPermanentRedirect: // 308 Resume Incomplete.
+		return false, nil
+	default:
+		return false, fmt.Errorf("append chunk at offset %d failed: %s", offset, resp.Status)
+	}
+}
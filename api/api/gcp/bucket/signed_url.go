@@ -0,0 +1,112 @@
+// Package bucket: signed_url.go issues V4-signed GCS URLs, caching them in-process so
+// repeated list requests for the same file and TTL don't re-sign on every call.
+package bucket
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/storage"
+
+	"github.com/cienet/ldsgo/config"
+)
+
+// signedURLCacheCapacity bounds how many signed URLs are cached in-process.
+const signedURLCacheCapacity = 1024
+
+type signedURLCacheKey struct {
+	path      string
+	ttlBucket int64
+}
+
+type signedURLCacheEntry struct {
+	url     string
+	expires time.Time
+}
+
+type signedURLCacheItem struct {
+	key   signedURLCacheKey
+	entry signedURLCacheEntry
+}
+
+// signedURLLRU is a small, fixed-capacity in-process LRU of signed URLs.
+type signedURLLRU struct {
+	mu      sync.Mutex
+	entries map[signedURLCacheKey]*list.Element
+	order   *list.List
+}
+
+var urlCache = &signedURLLRU{
+	entries: make(map[signedURLCacheKey]*list.Element),
+	order:   list.New(),
+}
+
+func (c *signedURLLRU) get(key signedURLCacheKey) (signedURLCacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[key]
+	if !ok {
+		return signedURLCacheEntry{}, false
+	}
+	item := el.Value.(*signedURLCacheItem)
+	if time.Now().After(item.entry.expires) {
+		c.order.Remove(el)
+		delete(c.entries, key)
+		return signedURLCacheEntry{}, false
+	}
+	c.order.MoveToFront(el)
+	return item.entry, true
+}
+
+func (c *signedURLLRU) put(key signedURLCacheKey, entry signedURLCacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.entries[key]; ok {
+		el.Value.(*signedURLCacheItem).entry = entry
+		c.order.MoveToFront(el)
+		return
+	}
+
+	el := c.order.PushFront(&signedURLCacheItem{key: key, entry: entry})
+	c.entries[key] = el
+	if c.order.Len() > signedURLCacheCapacity {
+		oldest := c.order.Back()
+		if oldest != nil {
+			c.order.Remove(oldest)
+			delete(c.entries, oldest.Value.(*signedURLCacheItem).key)
+		}
+	}
+}
+
+// ttlBucket buckets a TTL to the minute so near-identical requests share a cache entry.
+func ttlBucket(ttl time.Duration) int64 {
+	return int64(ttl / time.Minute)
+}
+
+// SignedURL returns a V4-signed URL for the object at path, valid for ttl. Results are
+// cached in-process, keyed by (path, ttl-bucket), until they expire.
+func SignedURL(ctx context.Context, client *storage.Client, path string, ttl time.Duration) (string, time.Time, error) {
+	key := signedURLCacheKey{path: path, ttlBucket: ttlBucket(ttl)}
+	if entry, ok := urlCache.get(key); ok {
+		return entry.url, entry.expires, nil
+	}
+
+	expires := time.Now().Add(ttl)
+	url, err := client.Bucket(config.Config.BucketName).SignedURL(path, &storage.SignedURLOptions{
+		Scheme:  storage.SigningSchemeV4,
+		Method:  http.MethodGet,
+		Expires: expires,
+	})
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("sign url for %q: %w", path, err)
+	}
+
+	urlCache.put(key, signedURLCacheEntry{url: url, expires: expires})
+	return url, expires, nil
+}
@@ -0,0 +1,255 @@
+// Package firestore: collections.go persists named collections ("albums") of files and
+// the ordered membership of files within them.
+package firestore
+
+import (
+	"context"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+)
+
+const collectionsCollection = "collections"
+const itemsSubcollection = "items"
+
+// Field names used when patching a CollectionRec document with MergeCollection.
+const (
+	FieldCollectionName        = "name"
+	FieldCollectionCoverFileID = "coverFileId"
+)
+
+// CollectionRec is the subset of a collection document that callers write.
+type CollectionRec struct {
+	Name        string `firestore:"name"`
+	CoverFileID string `firestore:"coverFileId,omitempty"`
+}
+
+// Collection is a full collection document, including server-assigned fields.
+type Collection struct {
+	CollectionRec
+	ID         string    `firestore:"-"`
+	CreateTime time.Time `firestore:"createTime"`
+	UpdateTime time.Time `firestore:"updateTime"`
+}
+
+// itemRec is a single file's membership row within a collection's items subcollection.
+type itemRec struct {
+	FileID   string `firestore:"fileId"`
+	Position int    `firestore:"position"`
+}
+
+func toCollection(doc *firestore.DocumentSnapshot) (*Collection, error) {
+	var col Collection
+	if err := doc.DataTo(&col); err != nil {
+		return nil, err
+	}
+	col.ID = doc.Ref.ID
+	return &col, nil
+}
+
+// CreateCollection writes a new collection document with the given id.
+func CreateCollection(ctx context.Context, client *firestore.Client, id string, rec *CollectionRec) (*Collection, error) {
+	now := time.Now()
+	data := map[string]interface{}{
+		FieldCollectionName:        rec.Name,
+		FieldCollectionCoverFileID: rec.CoverFileID,
+		"createTime":               now,
+		"updateTime":               now,
+	}
+	ref := client.Collection(collectionsCollection).Doc(id)
+	if _, err := ref.Set(ctx, data); err != nil {
+		return nil, err
+	}
+	return GetCollection(ctx, client, id)
+}
+
+// GetCollection fetches the collection document with the given id.
+func GetCollection(ctx context.Context, client *firestore.Client, id string) (*Collection, error) {
+	doc, err := client.Collection(collectionsCollection).Doc(id).Get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return toCollection(doc)
+}
+
+// MergeCollection patches the given fields on the collection document with the given id.
+func MergeCollection(ctx context.Context, client *firestore.Client, id string, fields *map[string]interface{}) (*Collection, error) {
+	ref := client.Collection(collectionsCollection).Doc(id)
+	// A merge Set would create a missing document, so check existence first.
+	if _, err := ref.Get(ctx); err != nil {
+		return nil, err
+	}
+	data := *fields
+	data["updateTime"] = time.Now()
+	if _, err := ref.Set(ctx, data, firestore.MergeAll); err != nil {
+		return nil, err
+	}
+	return GetCollection(ctx, client, id)
+}
+
+// DeleteCollection removes the collection document along with all of its membership rows.
+// It does not touch the member files' own Collections reverse-index, so the deleted
+// collection's id stays in those files' Collections field.
+func DeleteCollection(ctx context.Context, client *firestore.Client, id string) error {
+	iter := client.Collection(collectionsCollection).Doc(id).Collection(itemsSubcollection).Documents(ctx)
+	defer iter.Stop()
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := doc.Ref.Delete(ctx); err != nil {
+			return err
+		}
+	}
+
+	_, err := client.Collection(collectionsCollection).Doc(id).Delete(ctx)
+	return err
+}
+
+// ListCollections lists collections, most recently updated first, capped at size results.
+func ListCollections(ctx context.Context, client *firestore.Client, size int) ([]*Collection, error) {
+	iter := client.Collection(collectionsCollection).
+		OrderBy("updateTime", firestore.Desc).
+		Limit(size).
+		Documents(ctx)
+	defer iter.Stop()
+
+	var results []*Collection
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		col, err := toCollection(doc)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, col)
+	}
+	return results, nil
+}
+
+// AddCollectionItem adds fileID to collection id at position, creating or overwriting its
+// membership row, and records the membership on the file's own Collections reverse-index.
+// A nil position appends the file to the end of the collection's current order.
+func AddCollectionItem(ctx context.Context, client *firestore.Client, id string, fileID string, position *int) error {
+	pos, err := resolveItemPosition(ctx, client, id, position)
+	if err != nil {
+		return err
+	}
+
+	itemRef := client.Collection(collectionsCollection).Doc(id).Collection(itemsSubcollection).Doc(fileID)
+	if _, err := itemRef.Set(ctx, &itemRec{FileID: fileID, Position: pos}); err != nil {
+		return err
+	}
+
+	fileRef := client.Collection(filesCollection).Doc(fileID)
+	_, err = fileRef.Set(ctx, map[string]interface{}{
+		FieldCollections: firestore.ArrayUnion(id),
+		"updateTime":     time.Now(),
+	}, firestore.MergeAll)
+	return err
+}
+
+// resolveItemPosition returns position dereferenced when given, otherwise one past the
+// highest existing item position in collection id (0 when it has no items yet).
+func resolveItemPosition(ctx context.Context, client *firestore.Client, id string, position *int) (int, error) {
+	if position != nil {
+		return *position, nil
+	}
+
+	iter := client.Collection(collectionsCollection).Doc(id).Collection(itemsSubcollection).
+		OrderBy("position", firestore.Desc).
+		Limit(1).
+		Documents(ctx)
+	defer iter.Stop()
+
+	doc, err := iter.Next()
+	if err == iterator.Done {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	var last itemRec
+	if err := doc.DataTo(&last); err != nil {
+		return 0, err
+	}
+	return last.Position + 1, nil
+}
+
+// RemoveCollectionItem removes fileID's membership row from collection id, and clears the
+// membership from the file's own Collections reverse-index.
+func RemoveCollectionItem(ctx context.Context, client *firestore.Client, id string, fileID string) error {
+	itemRef := client.Collection(collectionsCollection).Doc(id).Collection(itemsSubcollection).Doc(fileID)
+	if _, err := itemRef.Delete(ctx); err != nil {
+		return err
+	}
+
+	fileRef := client.Collection(filesCollection).Doc(fileID)
+	_, err := fileRef.Set(ctx, map[string]interface{}{
+		FieldCollections: firestore.ArrayRemove(id),
+		"updateTime":     time.Now(),
+	}, firestore.MergeAll)
+	return err
+}
+
+// RemoveFileFromCollections removes fileID's membership row from every collection in ids.
+// Unlike RemoveCollectionItem it does not touch the file's own Collections field, since
+// DeleteFile calls this right before the file record itself is permanently removed.
+func RemoveFileFromCollections(ctx context.Context, client *firestore.Client, fileID string, ids []string) error {
+	for _, id := range ids {
+		itemRef := client.Collection(collectionsCollection).Doc(id).Collection(itemsSubcollection).Doc(fileID)
+		if _, err := itemRef.Delete(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListByCollection lists the file metadata documents belonging to collection id, in the
+// collection's own item order, capped at size results. A membership row whose file
+// metadata can no longer be found (e.g. the file was permanently deleted), or whose file
+// is soft-deleted, is skipped -- matching ListByTags, trashed files don't resurface here.
+func ListByCollection(ctx context.Context, client *firestore.Client, id string, size int) ([]*FileMeta, error) {
+	iter := client.Collection(collectionsCollection).Doc(id).Collection(itemsSubcollection).
+		OrderBy("position", firestore.Asc).
+		Limit(size).
+		Documents(ctx)
+	defer iter.Stop()
+
+	var results []*FileMeta
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var item itemRec
+		if err := doc.DataTo(&item); err != nil {
+			return nil, err
+		}
+
+		meta, err := Get(ctx, client, item.FileID)
+		if err != nil {
+			continue
+		}
+		if meta.DeletedAt != nil {
+			continue
+		}
+		results = append(results, meta)
+	}
+	return results, nil
+}
@@ -0,0 +1,21 @@
+package firestore
+
+import (
+	"context"
+	"testing"
+)
+
+// TestResolveItemPositionExplicit covers the explicit-position branch of
+// resolveItemPosition, which never touches Firestore and so needs no emulator. The
+// append-to-end branch reads the collection's items subcollection and is covered by
+// integration tests against a Firestore emulator instead.
+func TestResolveItemPositionExplicit(t *testing.T) {
+	five := 5
+	pos, err := resolveItemPosition(context.Background(), nil, "collection-1", &five)
+	if err != nil {
+		t.Fatalf("resolveItemPosition() error = %s", err)
+	}
+	if pos != five {
+		t.Errorf("resolveItemPosition() = %d, want %d", pos, five)
+	}
+}
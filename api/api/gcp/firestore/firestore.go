@@ -0,0 +1,252 @@
+// Package firestore wraps the Firestore collections used to persist file metadata.
+package firestore
+
+import (
+	"context"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+)
+
+const filesCollection = "files"
+
+// Client is the Firestore client type returned by NewClient.
+type Client = firestore.Client
+
+// Field names used when patching a FileMetaRec document with Merge.
+const (
+	FieldPath        = "path"
+	FieldName        = "name"
+	FieldSize        = "fileSize"
+	FieldTags        = "tags"
+	FieldOrderNo     = "orderNo"
+	FieldHash        = "hash"
+	FieldBlurHash    = "blurHash"
+	FieldSourceURL   = "sourceUrl"
+	FieldDeletedAt   = "deletedAt"
+	FieldCollections = "collections"
+)
+
+// FileMetaRec is the subset of a file metadata document that callers write.
+type FileMetaRec struct {
+	Path        string   `firestore:"path"`
+	Name        string   `firestore:"name"`
+	FileSize    int64    `firestore:"fileSize"`
+	Tags        []string `firestore:"tags"`
+	OrderNo     string   `firestore:"orderNo"`
+	Hash        string   `firestore:"hash"`
+	BlurHash    string   `firestore:"blurHash"`
+	SourceURL   string   `firestore:"sourceUrl,omitempty"`
+	Collections []string `firestore:"collections,omitempty"`
+}
+
+// FileMeta is a full file metadata document, including server-assigned fields.
+type FileMeta struct {
+	FileMetaRec
+	ID         string     `firestore:"-"`
+	CreateTime time.Time  `firestore:"createTime"`
+	UpdateTime time.Time  `firestore:"updateTime"`
+	DeletedAt  *time.Time `firestore:"deletedAt"`
+}
+
+// NewClient creates a new Firestore client for the default project.
+func NewClient(ctx context.Context) *firestore.Client {
+	client, err := firestore.NewClient(ctx, firestore.DetectProjectID)
+	if err != nil {
+		panic(err)
+	}
+	return client
+}
+
+func toFileMeta(doc *firestore.DocumentSnapshot) (*FileMeta, error) {
+	var meta FileMeta
+	if err := doc.DataTo(&meta); err != nil {
+		return nil, err
+	}
+	meta.ID = doc.Ref.ID
+	return &meta, nil
+}
+
+// Create writes a new file metadata document with the given id.
+func Create(ctx context.Context, client *firestore.Client, id string, rec *FileMetaRec) (*FileMeta, error) {
+	now := time.Now()
+	data := map[string]interface{}{
+		FieldPath:        rec.Path,
+		FieldName:        rec.Name,
+		FieldSize:        rec.FileSize,
+		FieldTags:        rec.Tags,
+		FieldOrderNo:     rec.OrderNo,
+		FieldHash:        rec.Hash,
+		FieldBlurHash:    rec.BlurHash,
+		FieldSourceURL:   rec.SourceURL,
+		FieldDeletedAt:   nil,
+		FieldCollections: rec.Collections,
+		"createTime":     now,
+		"updateTime":     now,
+	}
+	ref := client.Collection(filesCollection).Doc(id)
+	if _, err := ref.Set(ctx, data); err != nil {
+		return nil, err
+	}
+	return Get(ctx, client, id)
+}
+
+// Get fetches the file metadata document with the given id.
+func Get(ctx context.Context, client *firestore.Client, id string) (*FileMeta, error) {
+	doc, err := client.Collection(filesCollection).Doc(id).Get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return toFileMeta(doc)
+}
+
+// Merge patches the given fields on the file metadata document with the given id.
+func Merge(ctx context.Context, client *firestore.Client, id string, fields *map[string]interface{}) (*FileMeta, error) {
+	data := *fields
+	data["updateTime"] = time.Now()
+	ref := client.Collection(filesCollection).Doc(id)
+	if _, err := ref.Set(ctx, data, firestore.MergeAll); err != nil {
+		return nil, err
+	}
+	return Get(ctx, client, id)
+}
+
+// Delete removes the file metadata document with the given id.
+func Delete(ctx context.Context, client *firestore.Client, id string) error {
+	_, err := client.Collection(filesCollection).Doc(id).Delete(ctx)
+	return err
+}
+
+// Trash marks the file metadata document with the given id as soft-deleted, leaving its
+// bucket object in place. Trashed records are excluded from ListByTags.
+func Trash(ctx context.Context, client *firestore.Client, id string) (*FileMeta, error) {
+	now := time.Now()
+	ref := client.Collection(filesCollection).Doc(id)
+	fields := map[string]interface{}{
+		FieldDeletedAt: now,
+		"updateTime":   now,
+	}
+	if _, err := ref.Set(ctx, fields, firestore.MergeAll); err != nil {
+		return nil, err
+	}
+	return Get(ctx, client, id)
+}
+
+// Restore clears DeletedAt on the file metadata document with the given id and gives it
+// a fresh orderNo so it reappears at the front of the active list.
+func Restore(ctx context.Context, client *firestore.Client, id string, orderNo string) (*FileMeta, error) {
+	ref := client.Collection(filesCollection).Doc(id)
+	// A merge Set would create a missing document, so check existence first.
+	if _, err := ref.Get(ctx); err != nil {
+		return nil, err
+	}
+	fields := map[string]interface{}{
+		FieldDeletedAt: nil,
+		FieldOrderNo:   orderNo,
+		"updateTime":   time.Now(),
+	}
+	if _, err := ref.Set(ctx, fields, firestore.MergeAll); err != nil {
+		return nil, err
+	}
+	return Get(ctx, client, id)
+}
+
+// ListTrash lists soft-deleted file metadata documents, most recently trashed first,
+// capped at size results.
+func ListTrash(ctx context.Context, client *firestore.Client, size int) ([]*FileMeta, error) {
+	iter := client.Collection(filesCollection).
+		Where(FieldDeletedAt, "!=", nil).
+		OrderBy(FieldDeletedAt, firestore.Desc).
+		Limit(size).
+		Documents(ctx)
+	defer iter.Stop()
+	return collectFileMetas(iter)
+}
+
+// ListPurgeable lists soft-deleted file metadata documents whose DeletedAt is older than
+// cutoff, for the background janitor sweep to permanently remove.
+func ListPurgeable(ctx context.Context, client *firestore.Client, cutoff time.Time) ([]*FileMeta, error) {
+	iter := client.Collection(filesCollection).Where(FieldDeletedAt, "<", cutoff).Documents(ctx)
+	defer iter.Stop()
+	return collectFileMetas(iter)
+}
+
+func collectFileMetas(iter *firestore.DocumentIterator) ([]*FileMeta, error) {
+	var results []*FileMeta
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		meta, err := toFileMeta(doc)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, meta)
+	}
+	return results, nil
+}
+
+// FindByHash looks up an existing file metadata document with the given content hash and
+// size, for upload deduplication. It returns nil, nil when no match exists.
+func FindByHash(ctx context.Context, client *firestore.Client, hash string, size int64) (*FileMeta, error) {
+	iter := client.Collection(filesCollection).
+		Where(FieldHash, "==", hash).
+		Where(FieldSize, "==", size).
+		Limit(1).
+		Documents(ctx)
+	defer iter.Stop()
+
+	doc, err := iter.Next()
+	if err == iterator.Done {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return toFileMeta(doc)
+}
+
+// CountByPath returns the number of file metadata documents whose bucket path is path,
+// used to decide whether a deduplicated bucket object still has any referents.
+func CountByPath(ctx context.Context, client *firestore.Client, path string) (int, error) {
+	iter := client.Collection(filesCollection).Where(FieldPath, "==", path).Documents(ctx)
+	defer iter.Stop()
+
+	count := 0
+	for {
+		_, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+// ListByTags lists file metadata documents matching any of tags (or all documents when
+// tags is empty), ordered by orderNo descending, starting after the given orderNo cursor
+// and capped at size results.
+func ListByTags(ctx context.Context, client *firestore.Client, tags []string, orderNo string, size int) ([]*FileMeta, error) {
+	q := client.Collection(filesCollection).
+		Where(FieldDeletedAt, "==", nil).
+		OrderBy(FieldOrderNo, firestore.Desc).
+		Limit(size)
+	if len(tags) > 0 {
+		q = q.Where(FieldTags, "array-contains-any", tags)
+	}
+	if orderNo != "" {
+		q = q.StartAfter(orderNo)
+	}
+
+	iter := q.Documents(ctx)
+	defer iter.Stop()
+	return collectFileMetas(iter)
+}
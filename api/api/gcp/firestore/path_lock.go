@@ -0,0 +1,82 @@
+// Package firestore: path_lock.go coordinates dedup uploads against concurrent deletes of
+// the same bucket path, so "is this path still referenced" and "create a record that
+// reuses it" can't race each other into a record pointing at a deleted bucket object.
+package firestore
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const pathLocksCollection = "pathLocks"
+const pathLockTTL = 30 * time.Second
+const pathLockRetryInterval = 100 * time.Millisecond
+const pathLockWaitTimeout = 10 * time.Second
+
+// pathLockID derives a Firestore-safe document id from a bucket path, which may itself
+// contain "/" -- invalid inside a single Firestore document id.
+func pathLockID(path string) string {
+	sum := sha256.Sum256([]byte(path))
+	return hex.EncodeToString(sum[:])
+}
+
+// acquirePathLock claims the lock for path, returning true when this call won the race --
+// i.e. no unexpired lock for path already existed. Locks expire on their own after
+// pathLockTTL in case a holder crashes before releasing one.
+func acquirePathLock(ctx context.Context, client *firestore.Client, path string) (bool, error) {
+	ref := client.Collection(pathLocksCollection).Doc(pathLockID(path))
+	acquired := false
+
+	err := client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if err != nil && status.Code(err) != codes.NotFound {
+			return err
+		}
+		if err == nil {
+			var lock struct {
+				ExpiresAt time.Time `firestore:"expiresAt"`
+			}
+			if derr := doc.DataTo(&lock); derr == nil && time.Now().Before(lock.ExpiresAt) {
+				return nil // Still held by another request.
+			}
+		}
+		acquired = true
+		return tx.Set(ref, map[string]interface{}{"expiresAt": time.Now().Add(pathLockTTL)})
+	})
+	return acquired, err
+}
+
+// releasePathLock releases a lock previously claimed by acquirePathLock.
+func releasePathLock(ctx context.Context, client *firestore.Client, path string) error {
+	_, err := client.Collection(pathLocksCollection).Doc(pathLockID(path)).Delete(ctx)
+	return err
+}
+
+// WithPathLock runs fn while holding the lock for path, blocking with retries (up to
+// pathLockWaitTimeout) when another request currently holds it. Unlike the janitor's purge
+// lock, this guards a synchronous request-path operation, so it waits instead of skipping.
+func WithPathLock(ctx context.Context, client *firestore.Client, path string, fn func() error) error {
+	deadline := time.Now().Add(pathLockWaitTimeout)
+	for {
+		acquired, err := acquirePathLock(ctx, client, path)
+		if err != nil {
+			return err
+		}
+		if acquired {
+			break
+		}
+		if time.Now().After(deadline) {
+			return status.Error(codes.DeadlineExceeded, "timed out waiting for path lock on "+path)
+		}
+		time.Sleep(pathLockRetryInterval)
+	}
+	defer releasePathLock(ctx, client, path) // nolint: errcheck
+
+	return fn()
+}
@@ -0,0 +1,47 @@
+// Package firestore: purge_lock.go coordinates the trash janitor across app replicas so
+// only one of them purges a given soft-deleted record.
+package firestore
+
+import (
+	"context"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const purgeLocksCollection = "purgeLocks"
+const purgeLockTTL = 5 * time.Minute
+
+// AcquirePurgeLock claims the purge lock for id, returning true when this call won the
+// race -- i.e. no unexpired lock for id already existed. Locks expire on their own after
+// purgeLockTTL in case a sweep crashes before releasing one.
+func AcquirePurgeLock(ctx context.Context, client *firestore.Client, id string) (bool, error) {
+	ref := client.Collection(purgeLocksCollection).Doc(id)
+	acquired := false
+
+	err := client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if err != nil && status.Code(err) != codes.NotFound {
+			return err
+		}
+		if err == nil {
+			var lock struct {
+				ExpiresAt time.Time `firestore:"expiresAt"`
+			}
+			if derr := doc.DataTo(&lock); derr == nil && time.Now().Before(lock.ExpiresAt) {
+				return nil // Still held by another sweep.
+			}
+		}
+		acquired = true
+		return tx.Set(ref, map[string]interface{}{"expiresAt": time.Now().Add(purgeLockTTL)})
+	})
+	return acquired, err
+}
+
+// ReleasePurgeLock releases a lock previously claimed by AcquirePurgeLock.
+func ReleasePurgeLock(ctx context.Context, client *firestore.Client, id string) error {
+	_, err := client.Collection(purgeLocksCollection).Doc(id).Delete(ctx)
+	return err
+}
@@ -0,0 +1,116 @@
+// Package firestore: upload_session.go persists the state of in-progress resumable uploads.
+package firestore
+
+import (
+	"context"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+)
+
+const uploadsCollection = "uploads"
+
+// Field names used when patching an UploadSessionRec document.
+const (
+	FieldUploadOffset = "offset"
+)
+
+// UploadSessionRec is the subset of a resumable upload session document that callers write.
+type UploadSessionRec struct {
+	Path       string   `firestore:"path"`
+	Name       string   `firestore:"name"`
+	Tags       []string `firestore:"tags"`
+	Size       int64    `firestore:"size"`
+	Offset     int64    `firestore:"offset"`
+	SessionURI string   `firestore:"sessionUri"`
+}
+
+// UploadSession is a full resumable upload session document.
+type UploadSession struct {
+	UploadSessionRec
+	ID         string    `firestore:"-"`
+	CreateTime time.Time `firestore:"createTime"`
+	UpdateTime time.Time `firestore:"updateTime"`
+}
+
+func toUploadSession(doc *firestore.DocumentSnapshot) (*UploadSession, error) {
+	var sess UploadSession
+	if err := doc.DataTo(&sess); err != nil {
+		return nil, err
+	}
+	sess.ID = doc.Ref.ID
+	return &sess, nil
+}
+
+// CreateUploadSession writes a new upload session document with the given id.
+func CreateUploadSession(ctx context.Context, client *firestore.Client, id string, rec *UploadSessionRec) (*UploadSession, error) {
+	now := time.Now()
+	data := map[string]interface{}{
+		"path":       rec.Path,
+		"name":       rec.Name,
+		"tags":       rec.Tags,
+		"size":       rec.Size,
+		"offset":     rec.Offset,
+		"sessionUri": rec.SessionURI,
+		"createTime": now,
+		"updateTime": now,
+	}
+	ref := client.Collection(uploadsCollection).Doc(id)
+	if _, err := ref.Set(ctx, data); err != nil {
+		return nil, err
+	}
+	return GetUploadSession(ctx, client, id)
+}
+
+// GetUploadSession fetches the upload session document with the given id.
+func GetUploadSession(ctx context.Context, client *firestore.Client, id string) (*UploadSession, error) {
+	doc, err := client.Collection(uploadsCollection).Doc(id).Get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return toUploadSession(doc)
+}
+
+// UpdateUploadOffset advances the persisted byte offset for the session with the given id.
+func UpdateUploadOffset(ctx context.Context, client *firestore.Client, id string, offset int64) (*UploadSession, error) {
+	ref := client.Collection(uploadsCollection).Doc(id)
+	fields := map[string]interface{}{
+		FieldUploadOffset: offset,
+		"updateTime":      time.Now(),
+	}
+	if _, err := ref.Set(ctx, fields, firestore.MergeAll); err != nil {
+		return nil, err
+	}
+	return GetUploadSession(ctx, client, id)
+}
+
+// DeleteUploadSession removes the upload session document with the given id.
+func DeleteUploadSession(ctx context.Context, client *firestore.Client, id string) error {
+	_, err := client.Collection(uploadsCollection).Doc(id).Delete(ctx)
+	return err
+}
+
+// ListStaleUploadSessions lists upload sessions last updated before the given time, for
+// use by the abandoned-upload garbage collector.
+func ListStaleUploadSessions(ctx context.Context, client *firestore.Client, before time.Time) ([]*UploadSession, error) {
+	iter := client.Collection(uploadsCollection).Where("updateTime", "<", before).Documents(ctx)
+	defer iter.Stop()
+
+	var results []*UploadSession
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		sess, err := toUploadSession(doc)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, sess)
+	}
+	return results, nil
+}